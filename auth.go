@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+
+	gitTransport "gopkg.in/src-d/go-git.v4/plumbing/transport"
+	gitHTTP "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	gitSSH "gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+)
+
+// resolveAuth picks the go-git transport.AuthMethod for ctx in order of
+// precedence: an explicit ssh key, HTTPS basic auth (user/token), the ssh
+// agent (if SSH_AUTH_SOCK is set), or no auth at all for public repos.
+func resolveAuth(ctx *context) (gitTransport.AuthMethod, error) {
+	switch {
+	case ctx.key != "":
+		return gitSSH.NewPublicKeysFromFile("", ctx.key, "")
+	case ctx.httpToken != "":
+		return &gitHTTP.BasicAuth{
+			Username: ctx.httpUser,
+			Password: ctx.httpToken,
+		}, nil
+	case os.Getenv("SSH_AUTH_SOCK") != "":
+		return gitSSH.NewSSHAgentAuth("")
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+	git "gopkg.in/src-d/go-git.v4"
+	gitPlumbing "gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// commitInfo describes the pull that triggered a run, so runCommand can
+// expose it to the invoked command as GITWATCH_* env vars.
+type commitInfo struct {
+	oldSHA       string
+	newSHA       string
+	ref          string
+	author       string
+	message      string
+	changedFiles []string
+}
+
+// buildCommitInfo diffs oldHash..newHash in repo to describe what changed.
+// oldHash may be the zero hash (e.g. right after a fresh clone), in which
+// case the changed files list is left empty rather than diffed against
+// nothing.
+func buildCommitInfo(repo *git.Repository, oldHash, newHash gitPlumbing.Hash, ref string) (*commitInfo, error) {
+	newCommit, err := repo.CommitObject(newHash)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &commitInfo{
+		oldSHA:  oldHash.String(),
+		newSHA:  newHash.String(),
+		ref:     ref,
+		author:  newCommit.Author.String(),
+		message: strings.TrimSpace(newCommit.Message),
+	}
+
+	if oldHash.IsZero() || oldHash == newHash {
+		return info, nil
+	}
+
+	oldCommit, err := repo.CommitObject(oldHash)
+	if err != nil {
+		return nil, err
+	}
+
+	oldTree, err := oldCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	newTree, err := newCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := oldTree.Diff(newTree)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			// Deletions have no "To" side; fall back to the old path.
+			name = change.From.Name
+		}
+		info.changedFiles = append(info.changedFiles, name)
+	}
+
+	return info, nil
+}
+
+// commandEnv builds the environment for the invoked command: the process's
+// own environment plus, when info is available, the GITWATCH_* variables
+// describing what changed.
+func commandEnv(info *commitInfo) []string {
+	env := os.Environ()
+	if info == nil {
+		return env
+	}
+
+	return append(env,
+		fmt.Sprintf("GITWATCH_OLD_SHA=%s", info.oldSHA),
+		fmt.Sprintf("GITWATCH_NEW_SHA=%s", info.newSHA),
+		fmt.Sprintf("GITWATCH_REF=%s", info.ref),
+		fmt.Sprintf("GITWATCH_AUTHOR=%s", info.author),
+		fmt.Sprintf("GITWATCH_MESSAGE=%s", info.message),
+		fmt.Sprintf("GITWATCH_CHANGED_FILES=%s", strings.Join(info.changedFiles, " ")),
+	)
+}
+
+// matchesPathFilter reports whether any of the changed files match glob
+// (a doublestar pattern like "k8s/**/*.yaml"). An empty glob, or a nil info
+// describing a run with no diff to check (e.g. the initial post-clone
+// run), always matches. Callers must not pass nil here to mean "the diff
+// failed" — a failed diff should skip the run outright, since otherwise
+// --path-filter would fail open on a transient error.
+func matchesPathFilter(glob string, info *commitInfo) (bool, error) {
+	if glob == "" || info == nil {
+		return true, nil
+	}
+
+	for _, f := range info.changedFiles {
+		matched, err := doublestar.Match(glob, f)
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// repoConfig describes a single repo entry in a --config file. It carries
+// the same knobs as the CLI flags, but scoped to one repo so a single
+// gitwatch process can watch many.
+type repoConfig struct {
+	Repo            string   `yaml:"repo" json:"repo"`
+	Branch          string   `yaml:"branch" json:"branch"`
+	Key             string   `yaml:"key" json:"key"`
+	Dir             string   `yaml:"dir" json:"dir"`
+	IntervalSeconds int      `yaml:"intervalSeconds" json:"intervalSeconds"`
+	Command         string   `yaml:"command" json:"command"`
+	Args            []string `yaml:"args" json:"args"`
+	SlackWebhook    string   `yaml:"slackWebhook" json:"slackWebhook"`
+	SlackTitle      string   `yaml:"slackTitle" json:"slackTitle"`
+	Listen          string   `yaml:"listen" json:"listen"`
+	WebhookSecret   string   `yaml:"webhookSecret" json:"webhookSecret"`
+	HTTPUser        string   `yaml:"httpUser" json:"httpUser"`
+	HTTPToken       string   `yaml:"httpToken" json:"httpToken"`
+	Notify          []string `yaml:"notify" json:"notify"`
+	PathFilter      string   `yaml:"pathFilter" json:"pathFilter"`
+	CommandTimeout  string   `yaml:"commandTimeout" json:"commandTimeout"`
+	RetryCount      int      `yaml:"retryCount" json:"retryCount"`
+	RetryBackoff    string   `yaml:"retryBackoff" json:"retryBackoff"`
+}
+
+// multiConfig is the top level shape of a --config file.
+type multiConfig struct {
+	Repos []repoConfig `yaml:"repos" json:"repos"`
+}
+
+// loadConfig reads and parses a YAML or JSON config file. JSON is a subset
+// of YAML, so a single yaml.Unmarshal handles both.
+func loadConfig(path string) (*multiConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %v", err)
+	}
+
+	var cfg multiConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse config file: %v", err)
+	}
+
+	if len(cfg.Repos) == 0 {
+		return nil, fmt.Errorf("config file %s does not define any repos", path)
+	}
+
+	return &cfg, nil
+}
+
+// watchAll spins up one watchRepo goroutine per repo in cfg. Each repo's
+// fatal error is forwarded to endOfTimes as soon as it happens, tearing
+// down the whole process the same way a single-repo run would; it does
+// not wait for every repo to fail, since healthy repos poll forever and
+// never return on their own.
+func watchAll(cfg *multiConfig, log *logrus.Logger, endOfTimes chan error) {
+	repoErrs := make(chan error)
+
+	for _, rc := range cfg.Repos {
+		rc := rc
+		go func() {
+			ctx, err := contextFromRepoConfig(rc, log)
+			if err != nil {
+				repoErrs <- err
+				return
+			}
+			repoErr := make(chan error)
+			ctx.endOfTimes = repoErr
+			go watchRepo(ctx)
+			repoErrs <- <-repoErr
+		}()
+	}
+
+	go func() {
+		endOfTimes <- <-repoErrs
+	}()
+}
+
+// contextFromRepoConfig applies gitwatch's defaults (poll interval, branch)
+// on top of a repoConfig entry, mirroring the defaults the CLI flags use.
+func contextFromRepoConfig(rc repoConfig, log *logrus.Logger) (*context, error) {
+	branch := rc.Branch
+	if branch == "" {
+		branch = "master"
+	}
+
+	intervalSeconds := rc.IntervalSeconds
+	if intervalSeconds == 0 {
+		intervalSeconds = 30
+	}
+
+	notifyURLs := rc.Notify
+	if rc.SlackWebhook != "" {
+		notifyURLs = append(notifyURLs, "slack://"+strings.TrimPrefix(strings.TrimPrefix(rc.SlackWebhook, "https://"), "http://"))
+	}
+	notifiers, err := parseNotifiers(notifyURLs, rc.SlackTitle)
+	if err != nil {
+		return nil, fmt.Errorf("repo %s: %v", rc.Repo, err)
+	}
+
+	commandTimeout := rc.CommandTimeout
+	if commandTimeout == "" {
+		commandTimeout = "10m"
+	}
+	retryBackoff := rc.RetryBackoff
+	if retryBackoff == "" {
+		retryBackoff = "5s"
+	}
+	timeout, backoff, err := parseTimings(commandTimeout, retryBackoff)
+	if err != nil {
+		return nil, fmt.Errorf("repo %s: %v", rc.Repo, err)
+	}
+
+	return &context{
+		log:             log,
+		gitRepo:         rc.Repo,
+		branch:          branch,
+		key:             rc.Key,
+		destDir:         rc.Dir,
+		intervalSeconds: intervalSeconds,
+		cmd:             rc.Command,
+		args:            rc.Args,
+		slackWebhook:    rc.SlackWebhook,
+		slackTitle:      rc.SlackTitle,
+		listen:          rc.Listen,
+		webhookSecret:   rc.WebhookSecret,
+		httpUser:        rc.HTTPUser,
+		httpToken:       rc.HTTPToken,
+		notifiers:       notifiers,
+		pathFilter:      rc.PathFilter,
+		commandTimeout:  timeout,
+		retryCount:      rc.RetryCount,
+		retryBackoff:    backoff,
+	}, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	pullsAttempted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gitwatch_pulls_attempted_total",
+		Help: "Number of pulls attempted, per repo.",
+	}, []string{"repo"})
+
+	pullsSucceeded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gitwatch_pulls_succeeded_total",
+		Help: "Number of pulls that completed without error, per repo.",
+	}, []string{"repo"})
+
+	pullsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gitwatch_pulls_failed_total",
+		Help: "Number of pulls that returned an error, per repo.",
+	}, []string{"repo"})
+
+	secondsSinceLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gitwatch_seconds_since_last_successful_pull",
+		Help: "Seconds since the last successful pull, per repo.",
+	}, []string{"repo"})
+
+	commandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "gitwatch_command_duration_seconds",
+		Help: "Duration of the invoked command, per repo.",
+	}, []string{"repo"})
+
+	notificationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gitwatch_notification_failures_total",
+		Help: "Number of notification deliveries that failed, per repo and sink.",
+	}, []string{"repo", "sink"})
+)
+
+// startMetricsServer serves Prometheus metrics at /metrics and a liveness
+// check at /healthz. It's shared across all watched repos in a single
+// process, so it's started once from main rather than per repo.
+func startMetricsServer(addr string, log *logrus.Logger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	log.Infof("serving metrics on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Errorf("metrics server exited: %v", err)
+	}
+}
+
+// pullOutcome records the counters and the seconds-since-last-success gauge
+// for a single poll of repo. lastSuccess is updated in place when success is
+// true.
+func pullOutcome(repo string, success bool, lastSuccess *time.Time) {
+	pullsAttempted.WithLabelValues(repo).Inc()
+
+	if success {
+		pullsSucceeded.WithLabelValues(repo).Inc()
+		*lastSuccess = time.Now()
+		secondsSinceLastSuccess.WithLabelValues(repo).Set(0)
+	} else {
+		pullsFailed.WithLabelValues(repo).Inc()
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// RunResult carries the outcome of a runCommand invocation to notifiers.
+type RunResult struct {
+	Title   string `json:"title"`
+	Command string `json:"command"`
+	Output  string `json:"output"`
+	Success bool   `json:"success"`
+}
+
+// Notifier delivers a RunResult to some external sink (chat, webhook,
+// email, ...). Implementations should return a non-nil error on delivery
+// failure so the caller can log it; a failed notification never fails the
+// underlying command run.
+type Notifier interface {
+	Notify(result RunResult) error
+	// Name identifies the sink kind (slack, discord, teams, webhook, smtp)
+	// for metrics labeling.
+	Name() string
+}
+
+// parseNotifiers turns a list of sink URLs (as passed via repeatable
+// --notify flags) into concrete Notifiers. defaultTitle is the title that
+// the Slack, Discord and Teams sinks render; a sink URL cannot override it.
+func parseNotifiers(rawURLs []string, defaultTitle string) ([]Notifier, error) {
+	notifiers := make([]Notifier, 0, len(rawURLs))
+
+	for _, raw := range rawURLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --notify URL %q: %v", raw, err)
+		}
+
+		switch u.Scheme {
+		case "slack":
+			notifiers = append(notifiers, &slackNotifier{webhookURL: "https://" + u.Host + u.Path, title: defaultTitle})
+		case "discord":
+			notifiers = append(notifiers, &discordNotifier{webhookURL: "https://" + u.Host + u.Path, title: defaultTitle})
+		case "teams":
+			notifiers = append(notifiers, &teamsNotifier{webhookURL: "https://" + u.Host + u.Path, title: defaultTitle})
+		case "webhook":
+			n, err := newWebhookNotifier(u)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --notify URL %q: %v", raw, err)
+			}
+			notifiers = append(notifiers, n)
+		case "smtp":
+			n, err := newSMTPNotifier(u)
+			if err != nil {
+				return nil, fmt.Errorf("invalid --notify URL %q: %v", raw, err)
+			}
+			notifiers = append(notifiers, n)
+		default:
+			return nil, fmt.Errorf("unsupported --notify scheme %q, expected slack, discord, teams, webhook, or smtp", u.Scheme)
+		}
+	}
+
+	return notifiers, nil
+}
+
+func postJSON(url string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("got status %d: %s", resp.StatusCode, respBody)
+	}
+
+	return nil
+}
+
+type slackMessageField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type slackMessage struct {
+	Fallback string              `json:"fallback"`
+	Pretext  string              `json:"pretext"`
+	Color    string              `json:"color"`
+	Fields   []slackMessageField `json:"fields"`
+}
+
+type slackNotifier struct {
+	webhookURL string
+	title      string
+}
+
+func (n *slackNotifier) Name() string { return "slack" }
+
+func (n *slackNotifier) Notify(result RunResult) error {
+	color := "good"
+	if !result.Success {
+		color = "bad"
+	}
+
+	body, err := json.Marshal(slackMessage{
+		Fallback: n.title,
+		Pretext:  n.title,
+		Color:    color,
+		Fields: []slackMessageField{
+			{Title: "stdout and stderr", Value: fmt.Sprintf("```%s```", result.Output)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return postJSON(n.webhookURL, body)
+}
+
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Color       int    `json:"color"`
+}
+
+type discordMessage struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []discordEmbed `json:"embeds"`
+}
+
+type discordNotifier struct {
+	webhookURL string
+	title      string
+}
+
+func (n *discordNotifier) Name() string { return "discord" }
+
+func (n *discordNotifier) Notify(result RunResult) error {
+	color := 0x2ecc71 // green
+	if !result.Success {
+		color = 0xe74c3c // red
+	}
+
+	body, err := json.Marshal(discordMessage{
+		Content: n.title,
+		Embeds: []discordEmbed{
+			{Title: result.Command, Description: fmt.Sprintf("```%s```", result.Output), Color: color},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return postJSON(n.webhookURL, body)
+}
+
+// teamsMessage is an Office 365 connector "MessageCard".
+type teamsMessage struct {
+	Type       string `json:"@type"`
+	Context    string `json:"@context"`
+	ThemeColor string `json:"themeColor"`
+	Title      string `json:"title"`
+	Text       string `json:"text"`
+}
+
+type teamsNotifier struct {
+	webhookURL string
+	title      string
+}
+
+func (n *teamsNotifier) Name() string { return "teams" }
+
+func (n *teamsNotifier) Notify(result RunResult) error {
+	color := "2ecc71"
+	if !result.Success {
+		color = "e74c3c"
+	}
+
+	body, err := json.Marshal(teamsMessage{
+		Type:       "MessageCard",
+		Context:    "http://schema.org/extensions",
+		ThemeColor: color,
+		Title:      n.title,
+		Text:       fmt.Sprintf("%s\n\n```\n%s\n```", result.Command, result.Output),
+	})
+	if err != nil {
+		return err
+	}
+
+	return postJSON(n.webhookURL, body)
+}
+
+// webhookNotifier POSTs a RunResult to an arbitrary endpoint, for sinks
+// that don't speak Slack/Discord/Teams's formats natively. By default the
+// body is the RunResult marshaled as-is; a ?template= query param pointing
+// at a text/template file lets the caller shape the body to match whatever
+// the receiver (PagerDuty, Opsgenie, a custom CI hook, ...) expects.
+type webhookNotifier struct {
+	url  string
+	tmpl *template.Template
+}
+
+// newWebhookNotifier builds a webhookNotifier from a webhook:// --notify
+// URL. ?insecure=true and ?template=path are gitwatch's own control
+// params and are stripped before building the request URL; any other
+// query params (e.g. ?token=...) are passed through untouched so they
+// reach the receiver.
+func newWebhookNotifier(u *url.URL) (*webhookNotifier, error) {
+	query := u.Query()
+
+	scheme := "https"
+	if query.Get("insecure") == "true" {
+		scheme = "http"
+	}
+
+	var tmpl *template.Template
+	if tmplPath := query.Get("template"); tmplPath != "" {
+		t, err := template.ParseFiles(tmplPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse webhook template %q: %v", tmplPath, err)
+		}
+		tmpl = t
+	}
+
+	query.Del("insecure")
+	query.Del("template")
+
+	webhookURL := scheme + "://" + u.Host + u.Path
+	if encoded := query.Encode(); encoded != "" {
+		webhookURL += "?" + encoded
+	}
+
+	return &webhookNotifier{url: webhookURL, tmpl: tmpl}, nil
+}
+
+func (n *webhookNotifier) Name() string { return "webhook" }
+
+func (n *webhookNotifier) Notify(result RunResult) error {
+	if n.tmpl != nil {
+		var buf bytes.Buffer
+		if err := n.tmpl.Execute(&buf, result); err != nil {
+			return err
+		}
+		return postJSON(n.url, buf.Bytes())
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return postJSON(n.url, body)
+}
+
+type smtpNotifier struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+func newSMTPNotifier(u *url.URL) (*smtpNotifier, error) {
+	to := u.Query().Get("to")
+	if to == "" {
+		return nil, fmt.Errorf("smtp notifier requires a ?to= query param")
+	}
+
+	from := u.Query().Get("from")
+	if from == "" {
+		from = "gitwatch@localhost"
+	}
+
+	// smtp.SendMail needs host:port; fall back to the standard SMTP port
+	// when the URL gives only a host.
+	addr := u.Host
+	if u.Port() == "" {
+		addr += ":25"
+	}
+
+	n := &smtpNotifier{
+		addr: addr,
+		from: from,
+		to:   strings.Split(to, ","),
+	}
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		host := u.Hostname()
+		n.auth = smtp.PlainAuth("", u.User.Username(), password, host)
+	}
+
+	return n, nil
+}
+
+func (n *smtpNotifier) Name() string { return "smtp" }
+
+func (n *smtpNotifier) Notify(result RunResult) error {
+	status := "succeeded"
+	if !result.Success {
+		status = "failed"
+	}
+
+	msg := fmt.Sprintf("Subject: gitwatch: %s %s\r\n\r\n%s\r\n\r\n%s\r\n",
+		result.Command, status, result.Title, result.Output)
+
+	return smtp.SendMail(n.addr, n.auth, n.from, n.to, []byte(msg))
+}
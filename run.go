@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// commandRunner serializes command executions for a single repo: at most
+// one invocation of CMD runs at a time, and a burst of pulls while a run is
+// in flight coalesces into a single pending run against the latest commit
+// rather than piling up.
+type commandRunner struct {
+	ctx     *context
+	pending chan *commitInfo
+}
+
+func newCommandRunner(ctx *context) *commandRunner {
+	return &commandRunner{
+		ctx:     ctx,
+		pending: make(chan *commitInfo, 1),
+	}
+}
+
+// enqueue schedules a run for info, replacing any not-yet-started pending
+// run so only the latest commit is ever queued behind the one in flight.
+func (r *commandRunner) enqueue(info *commitInfo) {
+	for {
+		select {
+		case r.pending <- info:
+			return
+		default:
+			select {
+			case <-r.pending:
+			default:
+			}
+		}
+	}
+}
+
+// start runs enqueued commands one at a time until the process exits.
+func (r *commandRunner) start() {
+	for info := range r.pending {
+		runCommandWithRetry(r.ctx, info)
+	}
+}
+
+// runCommandWithRetry runs CMD, retrying up to ctx.retryCount times with
+// exponential backoff (starting at ctx.retryBackoff) if it fails.
+func runCommandWithRetry(ctx *context, info *commitInfo) error {
+	backoff := ctx.retryBackoff
+
+	var err error
+	var output string
+	for attempt := 0; attempt <= ctx.retryCount; attempt++ {
+		start := time.Now()
+		output, err = runOnce(ctx, info)
+		commandDuration.WithLabelValues(ctx.gitRepo).Observe(time.Since(start).Seconds())
+
+		if err == nil {
+			ctx.log.Info("success")
+			break
+		}
+
+		ctx.log.Error("error while running command")
+		ctx.log.Error(err)
+
+		if attempt < ctx.retryCount {
+			ctx.log.Warnf("retrying in %s (attempt %d/%d)", backoff, attempt+2, ctx.retryCount+1)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	result := RunResult{
+		Title:   ctx.slackTitle,
+		Command: strings.Join(append([]string{ctx.cmd}, ctx.args...), " "),
+		Output:  output,
+		Success: err == nil,
+	}
+
+	for _, n := range ctx.notifiers {
+		if notifyErr := n.Notify(result); notifyErr != nil {
+			ctx.log.Warnf("unable to send notification: %v", notifyErr)
+			notificationFailures.WithLabelValues(ctx.gitRepo, n.Name()).Inc()
+		}
+	}
+
+	return err
+}
+
+// parseTimings parses the --command-timeout and --retry-backoff duration
+// flags.
+func parseTimings(commandTimeout, retryBackoff string) (time.Duration, time.Duration, error) {
+	timeout, err := time.ParseDuration(commandTimeout)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid --command-timeout %q: %v", commandTimeout, err)
+	}
+
+	backoff, err := time.ParseDuration(retryBackoff)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid --retry-backoff %q: %v", retryBackoff, err)
+	}
+
+	return timeout, backoff, nil
+}
+
+// runOnce runs CMD a single time, streaming stdout/stderr to the logger
+// line-by-line as they arrive, and killing the command's whole process
+// group if it outlives ctx.commandTimeout. Every line is also kept in
+// memory and the combined output is returned for notifications; its size
+// is not capped.
+func runOnce(ctx *context, info *commitInfo) (string, error) {
+	ctx.log.WithFields(logrus.Fields{"command": strings.Join(append([]string{ctx.cmd}, ctx.args...), " ")}).Info("running command")
+
+	cmd := exec.Command(ctx.cmd, ctx.args...)
+	cmd.Env = commandEnv(info)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return "", err
+	}
+
+	var output strings.Builder
+	var outputMu sync.Mutex
+	stream := func(r io.Reader) {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			ctx.log.Info(line)
+			outputMu.Lock()
+			output.WriteString(line)
+			output.WriteString("\n")
+			outputMu.Unlock()
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); stream(stdout) }()
+	go func() { defer wg.Done(); stream(stderr) }()
+
+	waitDone := make(chan error, 1)
+	go func() {
+		wg.Wait()
+		waitDone <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(ctx.commandTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-waitDone:
+		return output.String(), err
+	case <-timer.C:
+		// Kill the whole process group, not just cmd's direct child, so
+		// anything the command spawned dies with it.
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-waitDone
+		return output.String(), fmt.Errorf("command timed out after %s", ctx.commandTimeout)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// pushPayload captures just the fields gitwatch needs out of GitHub/GitLab/Gitea
+// push webhook bodies. All three services agree closely enough on shape that
+// one struct can decode any of them.
+type pushPayload struct {
+	Ref string `json:"ref"`
+}
+
+// startWebhookServer runs an HTTP server that accepts push webhooks from
+// GitHub, GitLab, or Gitea and enqueues an immediate pull+run on runNow when
+// the pushed ref matches ctx.branch. It blocks until the server dies, at
+// which point it reports the error to ctx.endOfTimes.
+func startWebhookServer(ctx *context, runNow chan<- struct{}) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		handleWebhook(ctx, runNow, w, r)
+	})
+
+	ctx.log.Infof("listening for webhooks on %s", ctx.listen)
+	if err := http.ListenAndServe(ctx.listen, mux); err != nil {
+		ctx.endOfTimes <- err
+	}
+}
+
+func handleWebhook(ctx *context, runNow chan<- struct{}, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "unable to read body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := verifyWebhookSignature(ctx, r, body); err != nil {
+		ctx.log.WithFields(logrus.Fields{"remote": r.RemoteAddr}).Warnf("rejecting webhook: %v", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var payload pushPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	wantRef := fmt.Sprintf("refs/heads/%s", ctx.branch)
+	if payload.Ref != wantRef {
+		ctx.log.Debugf("ignoring webhook for ref %q, watching %q", payload.Ref, wantRef)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	ctx.log.Info("received push webhook for watched branch, enqueueing a run")
+	select {
+	case runNow <- struct{}{}:
+	default:
+		// A run is already pending; concurrent pushes coalesce into it.
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// verifyWebhookSignature validates GitHub's X-Hub-Signature-256 HMAC-SHA256
+// header or GitLab's X-Gitlab-Token header against ctx.webhookSecret. If no
+// secret is configured, verification is skipped.
+func verifyWebhookSignature(ctx *context, r *http.Request, body []byte) error {
+	if ctx.webhookSecret == "" {
+		return nil
+	}
+
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(ctx.webhookSecret)) != 1 {
+			return fmt.Errorf("gitlab token mismatch")
+		}
+		return nil
+	}
+
+	sig := r.Header.Get("X-Hub-Signature-256")
+	if sig == "" {
+		return fmt.Errorf("missing signature header")
+	}
+
+	sig = strings.TrimPrefix(sig, "sha256=")
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("malformed signature: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(ctx.webhookSecret))
+	mac.Write(body)
+	if !hmac.Equal(expected, mac.Sum(nil)) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	return nil
+}